@@ -0,0 +1,300 @@
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// OwnedByLabel marks resources created through ApplyWithTracking so the
+	// garbage collector can tell litmus-owned objects apart from ones a
+	// user has since adopted or hand-edited, and never touch the latter.
+	OwnedByLabel = "litmuschaos.io/owned-by"
+
+	appliedManifestConfigMapPrefix = "litmus-applied-manifest-"
+	appliedManifestDataKey         = "resources"
+)
+
+// AppliedResource is one entry in a workflow's applied-resource registry:
+// enough identity to find and delete the object again, the manifest hash so
+// ApplyWithTracking can skip re-applying a resource that hasn't changed
+// since last time, and the timestamp of that last apply.
+type AppliedResource struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Hash      string `json:"hash"`
+	AppliedAt string `json:"appliedAt"`
+}
+
+func (r AppliedResource) key() string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", r.Group, r.Version, r.Kind, r.Namespace, r.Name)
+}
+
+func appliedManifestConfigMapName(workflowID string) string {
+	return appliedManifestConfigMapPrefix + workflowID
+}
+
+func manifestHash(obj *unstructured.Unstructured) string {
+	data, _ := json.Marshal(obj.Object)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// getAppliedResources reads the previously-recorded resource set for a
+// workflow from its registry ConfigMap. A missing ConfigMap means this is
+// the workflow's first apply, so it is not an error.
+func getAppliedResources(workflowID string) ([]AppliedResource, error) {
+	clientset, err := GetGenericK8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps(AgentNamespace).Get(appliedManifestConfigMapName(workflowID), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []AppliedResource
+	if raw, ok := cm.Data[appliedManifestDataKey]; ok && raw != "" {
+		if err := json.Unmarshal([]byte(raw), &resources); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// putAppliedResources persists the resource set applied for a workflow,
+// creating its registry ConfigMap on the first apply and updating it on
+// every one after. An update must carry the live ResourceVersion or the API
+// server rejects it with a 422 Invalid (not NotFound), so the existing
+// ConfigMap is fetched first - the same get-then-write sequence doRequest's
+// "update" case uses in client.go.
+func putAppliedResources(workflowID, clusterID string, resources []AppliedResource) error {
+	clientset, err := GetGenericK8sClient()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(resources)
+	if err != nil {
+		return err
+	}
+
+	configMaps := clientset.CoreV1().ConfigMaps(AgentNamespace)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   appliedManifestConfigMapName(workflowID),
+			Labels: map[string]string{OwnedByLabel: workflowID},
+		},
+		Data: map[string]string{
+			appliedManifestDataKey: string(data),
+			"workflow_id":          workflowID,
+			"cluster_id":           clusterID,
+		},
+	}
+
+	existing, err := configMaps.Get(cm.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(cm)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	cm.ResourceVersion = existing.ResourceVersion
+	_, err = configMaps.Update(cm)
+	return err
+}
+
+// ApplyWithTracking applies manifests for a workflow the same way
+// ClusterOperationsBatch does, then reconciles the agent cluster against the
+// workflow's previously-applied resource set: anything that was applied
+// before but is absent from this apply is garbage collected - the same
+// generateDiff/stale-resource pattern work-api's ApplyWorkReconciler uses.
+// Every applied object is stamped with OwnedByLabel so the GC step only ever
+// deletes resources still owned by this workflow, never a user-managed one.
+func ApplyWithTracking(ctx context.Context, workflowID, clusterID string, manifests []string, requestType, namespace string) ([]BatchResult, error) {
+	objs, err := decodeManifestBatch(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := getAppliedResources(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	previousByKey := make(map[string]AppliedResource, len(previous))
+	for _, r := range previous {
+		previousByKey[r.key()] = r
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	manifestStrs := make([]string, 0, len(objs))
+	pendingByKey := make(map[string]AppliedResource, len(objs))
+	current := make([]AppliedResource, 0, len(objs))
+	unchanged := make([]BatchResult, 0, len(objs))
+	for _, obj := range objs {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[OwnedByLabel] = workflowID
+		obj.SetLabels(labels)
+
+		gvk := obj.GroupVersionKind()
+		resource := AppliedResource{
+			Group:     gvk.Group,
+			Version:   gvk.Version,
+			Kind:      gvk.Kind,
+			Namespace: namespace,
+			Name:      obj.GetName(),
+			Hash:      manifestHash(obj),
+		}
+
+		// A resource whose manifest hash hasn't moved since the last apply
+		// is already converged - skip re-sending it through the write path.
+		// requestType == "delete" always goes through, since an unchanged
+		// hash doesn't mean "already deleted".
+		if prev, ok := previousByKey[resource.key()]; ok && prev.Hash == resource.Hash && requestType != "delete" {
+			resource.AppliedAt = prev.AppliedAt
+			current = append(current, resource)
+			unchanged = append(unchanged, BatchResult{GVK: gvk, Name: obj.GetName(), Namespace: namespace})
+			continue
+		}
+
+		resource.AppliedAt = now
+		pendingByKey[resource.key()] = resource
+
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		manifestStrs = append(manifestStrs, string(data))
+	}
+
+	results, err := ClusterOperationsBatch(ctx, manifestStrs, requestType, namespace)
+
+	// current must reflect what actually happened, not what was requested:
+	// a result's own Error decides whether its AppliedResource is recorded as
+	// applied. A successful delete drops the entry from the registry instead
+	// of writing it back as "still applied"; a failed write carries the prior
+	// registry entry forward unchanged, so the GC diff below doesn't treat a
+	// resource that's still live as stale, and the next call's hash
+	// comparison still sees it as needing a retry.
+	for _, result := range results {
+		key := (AppliedResource{
+			Group:     result.GVK.Group,
+			Version:   result.GVK.Version,
+			Kind:      result.GVK.Kind,
+			Namespace: result.Namespace,
+			Name:      result.Name,
+		}).key()
+
+		pending, ok := pendingByKey[key]
+		if !ok {
+			continue
+		}
+
+		if result.Error != nil {
+			if prev, ok := previousByKey[key]; ok {
+				current = append(current, prev)
+			}
+			continue
+		}
+
+		if requestType == "delete" {
+			continue
+		}
+
+		current = append(current, pending)
+	}
+
+	results = append(results, unchanged...)
+	if err != nil {
+		return results, err
+	}
+
+	if err := garbageCollectStale(ctx, workflowID, previous, current); err != nil {
+		return results, fmt.Errorf("garbage collecting stale resources for workflow %s: %w", workflowID, err)
+	}
+
+	if err := putAppliedResources(workflowID, clusterID, current); err != nil {
+		return results, fmt.Errorf("recording applied resources for workflow %s: %w", workflowID, err)
+	}
+
+	return results, nil
+}
+
+// garbageCollectStale deletes every resource present in previous but absent
+// from current, provided it is still labeled as owned by workflowID. It
+// tolerates NotFound so a resource already removed by some other path
+// doesn't turn GC into a hard failure.
+func garbageCollectStale(ctx context.Context, workflowID string, previous, current []AppliedResource) error {
+	if len(previous) == 0 {
+		return nil
+	}
+
+	currentKeys := make(map[string]bool, len(current))
+	for _, r := range current {
+		currentKeys[r.key()] = true
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	for _, stale := range previous {
+		if currentKeys[stale.key()] {
+			continue
+		}
+
+		if err := deleteIfOwned(ctx, client, workflowID, stale); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteIfOwned(ctx context.Context, client *Client, workflowID string, stale AppliedResource) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{Group: stale.Group, Version: stale.Version, Kind: stale.Kind})
+	obj.SetName(stale.Name)
+
+	live, err := client.Get(ctx, obj, stale.Namespace)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if live.GetLabels()[OwnedByLabel] != workflowID {
+		// Adopted or hand-edited by someone else since we applied it - leave it.
+		return nil
+	}
+
+	err = client.Delete(ctx, obj, stale.Namespace)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,292 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	yaml_converter "github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	batchPollInterval = 2 * time.Second
+	batchPollTimeout  = 2 * time.Minute
+)
+
+// BatchResult reports the outcome of applying/deleting a single manifest as
+// part of a ClusterOperationsBatch call, so the caller can surface partial
+// failures instead of the whole batch aborting on the first error.
+type BatchResult struct {
+	GVK       schema.GroupVersionKind
+	Name      string
+	Namespace string
+	Error     error
+}
+
+type batchConfig struct {
+	dryRun bool
+}
+
+// BatchOption configures a ClusterOperationsBatch call.
+type BatchOption func(*batchConfig)
+
+// WithDryRun resolves GVRs for every manifest against the discovery cache
+// and reports the order the batch would run in, without touching the write
+// path or waiting on readiness.
+func WithDryRun() BatchOption {
+	return func(c *batchConfig) { c.dryRun = true }
+}
+
+// installPhases defines the dependency-aware install order for a batch:
+// Namespace -> CRD -> ServiceAccount -> Role/ClusterRole ->
+// RoleBinding/ClusterRoleBinding -> ConfigMap/Secret -> Service ->
+// Deployment/StatefulSet/DaemonSet -> Job/CronJob -> Workflow/CronWorkflow.
+// Kinds that match no phase are applied last, after all of the above.
+var installPhases = []map[string]bool{
+	{"Namespace": true},
+	{"CustomResourceDefinition": true},
+	{"ServiceAccount": true},
+	{"Role": true, "ClusterRole": true},
+	{"RoleBinding": true, "ClusterRoleBinding": true},
+	{"ConfigMap": true, "Secret": true},
+	{"Service": true},
+	{"Deployment": true, "StatefulSet": true, "DaemonSet": true},
+	{"Job": true, "CronJob": true},
+	{"Workflow": true, "CronWorkflow": true},
+}
+
+func phaseIndex(kind string) int {
+	for i, phase := range installPhases {
+		if phase[kind] {
+			return i
+		}
+	}
+	return len(installPhases)
+}
+
+// ClusterOperationsBatch applies (or deletes, for requestType == "delete")
+// a set of manifests against the agent cluster in dependency-aware order,
+// waiting for each phase to become ready before moving on to the next one.
+// The readiness wait is skipped for requestType == "delete": there is
+// nothing to become ready for an object that was just removed, and waiting
+// anyway would just block until batchPollTimeout and return a spurious
+// error despite the delete having succeeded. Each entry in manifests may
+// itself be a "---"-separated YAML stream or a JSON array of manifests;
+// both are expanded before ordering. Unlike
+// ClusterOperations, a failure on one manifest does not abort the rest of
+// the batch - every outcome is reported back in the returned []BatchResult.
+func ClusterOperationsBatch(ctx context.Context, manifests []string, requestType, namespace string, opts ...BatchOption) ([]BatchResult, error) {
+	cfg := &batchConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	objs, err := decodeManifestBatch(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(objs, func(i, j int) bool {
+		return phaseIndex(objs[i].GetKind()) < phaseIndex(objs[j].GetKind())
+	})
+	if requestType == "delete" {
+		for i, j := 0, len(objs)-1; i < j; i, j = i+1, j-1 {
+			objs[i], objs[j] = objs[j], objs[i]
+		}
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, 0, len(objs))
+	currentPhase := -1
+
+	for _, obj := range objs {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		phase := phaseIndex(obj.GetKind())
+		if phase != currentPhase {
+			if currentPhase >= 0 && !cfg.dryRun && requestType != "delete" {
+				if err := waitForPhaseReady(ctx, client, objs, currentPhase, namespace); err != nil {
+					return results, fmt.Errorf("waiting for phase %d to become ready: %w", currentPhase, err)
+				}
+			}
+			currentPhase = phase
+		}
+
+		result := BatchResult{GVK: obj.GroupVersionKind(), Name: obj.GetName(), Namespace: namespace}
+
+		if cfg.dryRun {
+			if _, err := client.resource(obj.GroupVersionKind(), namespace); err != nil {
+				result.Error = err
+			}
+			results = append(results, result)
+			continue
+		}
+
+		if _, err := client.doRequest(ctx, requestType, obj, namespace); err != nil {
+			result.Error = err
+		}
+		results = append(results, result)
+	}
+
+	if currentPhase >= 0 && !cfg.dryRun && requestType != "delete" {
+		if err := waitForPhaseReady(ctx, client, objs, currentPhase, namespace); err != nil {
+			return results, fmt.Errorf("waiting for phase %d to become ready: %w", currentPhase, err)
+		}
+	}
+
+	return results, nil
+}
+
+// decodeManifestBatch expands every raw manifest entry - which may be a
+// single JSON manifest, a JSON array of manifests, or a "---"-separated
+// YAML stream - into a flat list of decoded objects.
+func decodeManifestBatch(manifests []string) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+
+	for _, raw := range manifests {
+		docs, err := splitManifestStream(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, doc := range docs {
+			obj := &unstructured.Unstructured{}
+			if _, _, err := decUnstructured.Decode([]byte(doc), nil, obj); err != nil {
+				return nil, fmt.Errorf("decoding manifest: %w", err)
+			}
+			objs = append(objs, obj)
+		}
+	}
+
+	return objs, nil
+}
+
+// splitManifestStream normalizes one batch entry into a slice of YAML
+// manifests, handling both of the accepted input shapes.
+func splitManifestStream(raw string) ([]string, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(trimmed, "[") {
+		var arr []json.RawMessage
+		if err := json.Unmarshal([]byte(trimmed), &arr); err != nil {
+			return nil, fmt.Errorf("decoding JSON manifest array: %w", err)
+		}
+
+		docs := make([]string, 0, len(arr))
+		for _, m := range arr {
+			yamlStr, err := yaml_converter.JSONToYAML(m)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, string(yamlStr))
+		}
+		return docs, nil
+	}
+
+	var docs []string
+	for _, doc := range strings.Split(trimmed, "\n---") {
+		doc = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(doc), "---"))
+		if doc == "" {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// waitForPhaseReady blocks until every object in the given phase is ready:
+// CRDs must report Established=True, Namespaces must exist, and workloads
+// must report Ready/Available, before the next phase's objects are applied.
+func waitForPhaseReady(ctx context.Context, client *Client, objs []*unstructured.Unstructured, phase int, namespace string) error {
+	for _, obj := range objs {
+		if phaseIndex(obj.GetKind()) != phase {
+			continue
+		}
+
+		switch obj.GetKind() {
+		case "CustomResourceDefinition":
+			if err := waitForCondition(ctx, client, obj, "", "Established"); err != nil {
+				return err
+			}
+		case "Namespace":
+			if err := waitForExists(ctx, client, obj, ""); err != nil {
+				return err
+			}
+		case "Deployment", "StatefulSet", "DaemonSet":
+			if err := waitForCondition(ctx, client, obj, namespace, "Available"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func waitForExists(ctx context.Context, client *Client, obj *unstructured.Unstructured, namespace string) error {
+	resource, err := client.resource(obj.GroupVersionKind(), namespace)
+	if err != nil {
+		return err
+	}
+
+	return wait.PollImmediate(batchPollInterval, batchPollTimeout, func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		_, err := resource.Get(obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// waitForCondition polls obj until its status.conditions contains
+// conditionType with status "True".
+func waitForCondition(ctx context.Context, client *Client, obj *unstructured.Unstructured, namespace, conditionType string) error {
+	resource, err := client.resource(obj.GroupVersionKind(), namespace)
+	if err != nil {
+		return err
+	}
+
+	return wait.PollImmediate(batchPollInterval, batchPollTimeout, func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		live, err := resource.Get(obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+
+		conditions, found, err := unstructured.NestedSlice(live.Object, "status", "conditions")
+		if err != nil || !found {
+			return false, nil
+		}
+
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if condition["type"] == conditionType && condition["status"] == "True" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,418 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	openapi_proto "k8s.io/kube-openapi/pkg/util/proto"
+
+	memory "k8s.io/client-go/discovery/cached"
+)
+
+const (
+	// FieldManager is the stable field-manager name litmus uses when
+	// Server-Side Applying resources to an agent cluster.
+	FieldManager = "litmus-agent"
+
+	// LastAppliedConfigAnnotation mirrors kubectl's client-side apply
+	// annotation, used by the three-way-merge fallback path.
+	LastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+	// mapperResetInterval bounds how long a CRD installed after agent
+	// startup can stay undiscoverable: the cached RESTMapper is rebuilt on
+	// this cadence in addition to being reset immediately on a NoMatchError.
+	mapperResetInterval = 10 * time.Minute
+)
+
+// Client is a per-cluster typed wrapper around the dynamic/discovery
+// clients. It replaces the package-level `dr dynamic.ResourceInterface`,
+// which stashed REST scope/namespace in a shared variable and raced when two
+// ClusterOperations calls ran concurrently - every method here resolves the
+// GVR for its own call instead.
+type Client struct {
+	dyn    dynamic.Interface
+	disc   discovery.CachedDiscoveryInterface
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+
+	mu sync.Mutex
+}
+
+// NewClient builds a Client from the agent's kubeconfig. It is safe, and
+// intended, to be constructed once and shared across goroutines - use
+// getClient for the package's shared instance rather than dialing a new one
+// per call.
+func NewClient() (*Client, error) {
+	discoveryClient, dynamicClient, err := GetDynamicAndDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := memory.NewMemCacheClient(discoveryClient)
+	c := &Client{
+		dyn:    dynamicClient,
+		disc:   cached,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(cached),
+	}
+
+	go c.periodicallyResetMapper()
+
+	return c, nil
+}
+
+var (
+	defaultClientOnce sync.Once
+	defaultClient     *Client
+	defaultClientErr  error
+)
+
+// getClient returns the package's shared Client, building it on first use.
+func getClient() (*Client, error) {
+	defaultClientOnce.Do(func() {
+		defaultClient, defaultClientErr = NewClient()
+	})
+	return defaultClient, defaultClientErr
+}
+
+func (c *Client) periodicallyResetMapper() {
+	ticker := time.NewTicker(mapperResetInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.mu.Lock()
+		c.disc.Invalidate()
+		c.mapper.Reset()
+		c.mu.Unlock()
+	}
+}
+
+// resource resolves the dynamic.ResourceInterface for gvk/namespace, retrying
+// once against a freshly-invalidated discovery cache on a NoMatchError - the
+// case a CRD installed after agent startup hits.
+func (c *Client) resource(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	c.mu.Lock()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		c.disc.Invalidate()
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return c.dyn.Resource(mapping.Resource).Namespace(namespace), nil
+	}
+	return c.dyn.Resource(mapping.Resource), nil
+}
+
+// List resolves gvk's GVR and lists resources in namespace matching opts.
+func (c *Client) List(ctx context.Context, gvk schema.GroupVersionKind, namespace string, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resource, err := c.resource(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return resource.List(opts)
+}
+
+// Get fetches obj by name/namespace.
+func (c *Client) Get(ctx context.Context, obj *unstructured.Unstructured, namespace string) (*unstructured.Unstructured, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resource, err := c.resource(obj.GroupVersionKind(), namespace)
+	if err != nil {
+		return nil, err
+	}
+	return resource.Get(obj.GetName(), metav1.GetOptions{})
+}
+
+// Create creates obj in namespace.
+func (c *Client) Create(ctx context.Context, obj *unstructured.Unstructured, namespace string) (*unstructured.Unstructured, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resource, err := c.resource(obj.GroupVersionKind(), namespace)
+	if err != nil {
+		return nil, err
+	}
+	return resource.Create(obj, metav1.CreateOptions{})
+}
+
+// Update replaces obj in namespace; the caller is expected to have already
+// copied over the live resourceVersion.
+func (c *Client) Update(ctx context.Context, obj *unstructured.Unstructured, namespace string) (*unstructured.Unstructured, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resource, err := c.resource(obj.GroupVersionKind(), namespace)
+	if err != nil {
+		return nil, err
+	}
+	return resource.Update(obj, metav1.UpdateOptions{})
+}
+
+// Delete deletes obj from namespace.
+func (c *Client) Delete(ctx context.Context, obj *unstructured.Unstructured, namespace string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	resource, err := c.resource(obj.GroupVersionKind(), namespace)
+	if err != nil {
+		return err
+	}
+	return resource.Delete(obj.GetName(), &metav1.DeleteOptions{})
+}
+
+// Apply performs a Kubernetes Server-Side Apply PATCH with FieldManager and
+// conflict resolution forced in litmus-agent's favour. Older API servers
+// (<1.16) reject the apply-patch content type with UnsupportedMediaType/
+// NotAcceptable, in which case Apply falls back to a client-side three-way
+// strategic-merge patch. Any other error (validation, forbidden, conflict)
+// is returned as-is rather than masked by the fallback.
+func (c *Client) Apply(ctx context.Context, obj *unstructured.Unstructured, namespace string) (*unstructured.Unstructured, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := c.resource(obj.GroupVersionKind(), namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	force := true
+	response, err := resource.Patch(obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: FieldManager,
+		Force:        &force,
+	})
+	if err == nil {
+		log.Println("Resource successfully server-side applied")
+		return response, nil
+	}
+
+	if !errors.IsUnsupportedMediaType(err) && !errors.IsNotAcceptable(err) {
+		return nil, err
+	}
+
+	log.Printf("server-side apply not supported by API server (%v), falling back to client-side three-way merge", err)
+	return c.clientSideApply(ctx, obj, namespace)
+}
+
+// clientSideApply computes a three-way strategic-merge patch between the
+// last-applied-configuration annotation, the live object and the incoming
+// manifest, and falls back to a JSON merge patch for CRDs/unstructured types
+// that have no strategic-merge schema registered. It stamps the
+// last-applied-configuration annotation on success, the same as kubectl.
+func (c *Client) clientSideApply(ctx context.Context, obj *unstructured.Unstructured, namespace string) (*unstructured.Unstructured, error) {
+	resource, err := c.resource(obj.GroupVersionKind(), namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	current, getErr := resource.Get(obj.GetName(), metav1.GetOptions{})
+	if errors.IsNotFound(getErr) {
+		return c.createWithLastApplied(ctx, obj, namespace)
+	}
+	if getErr != nil {
+		return nil, getErr
+	}
+
+	lastApplied, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	obj.SetAnnotations(mergeLastAppliedAnnotation(obj.GetAnnotations(), lastApplied))
+
+	modified, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	original := []byte(current.GetAnnotations()[LastAppliedConfigAnnotation])
+	current_, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	var patch []byte
+	patchType := types.MergePatchType
+	gvk := obj.GroupVersionKind()
+	if patchMeta, ok := c.lookupPatchMeta(gvk); ok {
+		patch, err = strategicpatch.CreateThreeWayMergePatch(original, modified, current_, patchMeta, true)
+		patchType = types.StrategicMergePatchType
+	} else {
+		patch, err = jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current_)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := resource.Patch(obj.GetName(), patchType, patch, metav1.PatchOptions{
+		FieldManager: FieldManager,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Resource successfully applied via client-side three-way merge")
+	return response, nil
+}
+
+// createWithLastApplied handles clientSideApply being invoked against a
+// resource that does not exist yet - apply always creates.
+func (c *Client) createWithLastApplied(ctx context.Context, obj *unstructured.Unstructured, namespace string) (*unstructured.Unstructured, error) {
+	modified, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	obj.SetAnnotations(mergeLastAppliedAnnotation(obj.GetAnnotations(), modified))
+
+	response, err := c.Create(ctx, obj, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Resource successfully created via apply")
+	return response, nil
+}
+
+func mergeLastAppliedAnnotation(annotations map[string]string, modified []byte) map[string]string {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[LastAppliedConfigAnnotation] = string(modified)
+	return annotations
+}
+
+// lookupPatchMeta consults the Client's discovery cache for gvk's OpenAPI
+// schema to decide whether a typed strategic-merge patch is possible.
+// Built-in kinds are registered under "io.k8s.api.<group>.<version>.<Kind>"
+// in the published OpenAPI definitions; CRDs never are, so the second return
+// value is false for them and the caller should fall back to a JSON merge
+// patch instead.
+func (c *Client) lookupPatchMeta(gvk schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, bool) {
+	doc, err := c.disc.OpenAPISchema()
+	if err != nil || doc == nil {
+		return nil, false
+	}
+
+	models, err := openapi_proto.NewOpenAPIData(doc)
+	if err != nil {
+		return nil, false
+	}
+
+	modelSchema := models.LookupModel(openAPIModelName(gvk))
+	if modelSchema == nil {
+		return nil, false
+	}
+
+	return strategicpatch.NewPatchMetaFromOpenAPI(modelSchema), true
+}
+
+// openAPIModelName maps a GVK onto the model name kube-openapi publishes for
+// it, e.g. {apps, v1, Deployment} -> "io.k8s.api.apps.v1.Deployment" and the
+// legacy core group {"", v1, Pod} -> "io.k8s.api.core.v1.Pod".
+func openAPIModelName(gvk schema.GroupVersionKind) string {
+	group := gvk.Group
+	if group == "" {
+		group = "core"
+	}
+	return fmt.Sprintf("io.k8s.api.%s.%s.%s", group, gvk.Version, gvk.Kind)
+}
+
+// doRequest dispatches requestType ("apply"/"create"/"update"/"delete"/"get")
+// against obj, the same behaviour the old package-level applyRequest had,
+// now resolving its dynamic.ResourceInterface per call instead of through
+// the shared `dr` variable.
+func (c *Client) doRequest(ctx context.Context, requestType string, obj *unstructured.Unstructured, namespace string) (*unstructured.Unstructured, error) {
+	switch requestType {
+	case "apply":
+		return c.Apply(ctx, obj, namespace)
+	case "create":
+		response, err := c.Create(ctx, obj, namespace)
+		if errors.IsAlreadyExists(err) {
+			log.Printf("%v already exists", obj.GetName())
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println("Resource successfully created")
+		return response, nil
+	case "update":
+		current, err := c.Get(ctx, obj, namespace)
+		if errors.IsNotFound(err) {
+			log.Printf("%v not found", obj.GetName())
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		obj.SetResourceVersion(current.GetResourceVersion())
+
+		response, err := c.Update(ctx, obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println("Resource successfully updated")
+		return response, nil
+	case "delete":
+		err := c.Delete(ctx, obj, namespace)
+		if errors.IsNotFound(err) {
+			log.Printf("%v not found", obj.GetName())
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println("Resource successfully deleted")
+		return &unstructured.Unstructured{}, nil
+	case "get":
+		response, err := c.Get(ctx, obj, namespace)
+		if errors.IsNotFound(err) {
+			log.Printf("%v not found", obj.GetName())
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println("Resource successfully retrieved")
+		return response, nil
+	}
+
+	return nil, fmt.Errorf("err: %v\n", "Invalid Request")
+}
@@ -2,21 +2,15 @@ package k8s
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"os"
 
 	yaml_converter "github.com/ghodss/yaml"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/restmapper"
-
-	memory "k8s.io/client-go/discovery/cached"
 )
 
 const (
@@ -24,9 +18,7 @@ const (
 )
 
 var (
-	Ctx             = context.Background()
 	decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
-	dr              dynamic.ResourceInterface
 	AgentNamespace  = os.Getenv("AGENT_NAMESPACE")
 )
 
@@ -82,77 +74,12 @@ func ClusterRegister(clusterData map[string]string) (bool, error) {
 	return true, nil
 }
 
-func applyRequest(requestType string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-	if requestType == "create" {
-		response, err := dr.Create(obj, metav1.CreateOptions{})
-		if errors.IsAlreadyExists(err) {
-			// This doesnt ever happen even if it does already exist
-			log.Printf("Already exists")
-			return nil, nil
-		}
-
-		if err != nil {
-			return nil, err
-		}
-
-		log.Println("Resource successfully created")
-		return response, nil
-	} else if requestType == "update" {
-		getObj, err := dr.Get(obj.GetName(), metav1.GetOptions{})
-		if errors.IsNotFound(err) {
-			// This doesnt ever happen even if it is already deleted or not found
-			log.Printf("%v not found", obj.GetName())
-			return nil, nil
-		}
-
-		if err != nil {
-			return nil, err
-		}
-
-		obj.SetResourceVersion(getObj.GetResourceVersion())
-
-		response, err := dr.Update(obj, metav1.UpdateOptions{})
-		if err != nil {
-			return nil, err
-		}
-
-		log.Println("Resource successfully updated")
-		return response, nil
-	} else if requestType == "delete" {
-		err := dr.Delete(obj.GetName(), &metav1.DeleteOptions{})
-		if errors.IsNotFound(err) {
-			// This doesnt ever happen even if it is already deleted or not found
-			log.Printf("%v not found", obj.GetName())
-			return nil, nil
-		}
-
-		if err != nil {
-			return nil, err
-		}
-
-		log.Println("Resource successfully deleted")
-		return &unstructured.Unstructured{}, nil
-	} else if requestType == "get" {
-		response, err := dr.Get(obj.GetName(), metav1.GetOptions{})
-		if errors.IsNotFound(err) {
-			// This doesnt ever happen even if it is already deleted or not found
-			log.Printf("%v not found", obj.GetName())
-			return nil, nil
-		}
-
-		if err != nil {
-			return nil, err
-		}
-
-		log.Println("Resource successfully retrieved")
-		return response, nil
-	}
-
-	return nil, fmt.Errorf("err: %v\n", "Invalid Request")
-}
-
-// This function handles cluster operations
-func ClusterOperations(manifest string, requestType string, namespace string) (*unstructured.Unstructured, error) {
+// ClusterOperations handles a single cluster operation (apply/create/update/
+// delete/get) for manifest, against the shared package Client. ctx threads
+// through to the Client call so callers can bound the request with a
+// timeout or cancel it, replacing the old `Ctx = context.Background()`
+// global.
+func ClusterOperations(ctx context.Context, manifest string, requestType string, namespace string) (*unstructured.Unstructured, error) {
 
 	// Converting JSON to YAML and store it in yamlStr variable
 	yamlStr, err := yaml_converter.JSONToYAML([]byte(manifest))
@@ -160,15 +87,6 @@ func ClusterOperations(manifest string, requestType string, namespace string) (*
 		return nil, err
 	}
 
-	// Getting dynamic and discovery client
-	discoveryClient, dynamicClient, err := GetDynamicAndDiscoveryClient()
-	if err != nil {
-		return nil, err
-	}
-
-	// Create a mapper using dynamic client
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
-
 	// Decode YAML manifest into unstructured.Unstructured
 	obj := &unstructured.Unstructured{}
 	_, gvk, err := decUnstructured.Decode([]byte(yamlStr), nil, obj)
@@ -176,31 +94,18 @@ func ClusterOperations(manifest string, requestType string, namespace string) (*
 		return nil, err
 	}
 
-	// Find GVR
-	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	client, err := getClient()
 	if err != nil {
 		return nil, err
 	}
 
-	// Obtain REST interface for the GVR
-	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
-		// namespaced resources should specify the namespace
-		dr = dynamicClient.Resource(mapping.Resource).Namespace(namespace)
-	} else {
-		// for cluster-wide resources
-		dr = dynamicClient.Resource(mapping.Resource)
-	}
-
 	if obj.GetKind() == "CronWorkflow" || obj.GetKind() == "Workflow" {
-		labels := obj.GetLabels()
-		pods, err := dr.List(metav1.ListOptions{
-			LabelSelector: labels["workflow_id"],
-		})
+		name, err := resolveWorkflowName(ctx, client, *gvk, namespace, obj.GetLabels()["workflow_id"])
 		if err != nil {
-			return nil, nil
+			return nil, err
 		}
-		obj.SetName(pods.Items[0].GetName())
+		obj.SetName(name)
 	}
 
-	return applyRequest(requestType, obj)
+	return client.doRequest(ctx, requestType, obj, namespace)
 }
@@ -0,0 +1,204 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// workflowGVK is the Argo Workflow CRD watched by WatchWorkflowEvents.
+var workflowGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Workflow"}
+
+// watchRetryBackoff bounds how quickly watchWorkflowEvents retries after
+// failing to resolve the Workflow GVR or start the watch, so a transient
+// hiccup (API server restart, CRD not yet discoverable at agent startup)
+// doesn't busy-loop.
+const watchRetryBackoff = 5 * time.Second
+
+// WorkflowEventType mirrors the subset of watch.EventType that callers of
+// WatchWorkflowEvents care about - Bookmark/Error are handled internally for
+// reconnect and never surfaced.
+type WorkflowEventType string
+
+const (
+	WorkflowEventAdded    WorkflowEventType = "Added"
+	WorkflowEventModified WorkflowEventType = "Modified"
+	WorkflowEventDeleted  WorkflowEventType = "Deleted"
+)
+
+// WorkflowEvent is a single observed change to an Argo Workflow, with the
+// phase and node-status pulled out of the CRD's status subresource so
+// callers don't have to walk unstructured data themselves.
+type WorkflowEvent struct {
+	Type  WorkflowEventType
+	Name  string
+	Phase string
+	Nodes map[string]interface{}
+}
+
+// WatchWorkflowEvents streams Added/Modified/Deleted events for the Workflow
+// matching workflowID in real time, replacing the old one-shot
+// `List` + `Items[0]` lookup that reconciliation loops used to poll status:
+// an empty match list there would panic, and more than one match silently
+// picked the wrong object. The returned channel is closed only when ctx is
+// cancelled - a failure to resolve the Workflow GVR or start the watch is
+// retried after watchRetryBackoff rather than closing the channel. On a 410
+// Gone/Expired watch error the resourceVersion bookmark is dropped and the
+// watch relists from scratch; any other disconnect resumes from the last
+// resourceVersion observed.
+func WatchWorkflowEvents(ctx context.Context, workflowID string) (<-chan WorkflowEvent, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan WorkflowEvent)
+	go client.watchWorkflowEvents(ctx, workflowID, events)
+	return events, nil
+}
+
+func (c *Client) watchWorkflowEvents(ctx context.Context, workflowID string, events chan<- WorkflowEvent) {
+	defer close(events)
+
+	resourceVersion := ""
+	for ctx.Err() == nil {
+		resource, err := c.resource(workflowGVK, AgentNamespace)
+		if err != nil {
+			log.Printf("resolving Workflow GVR for watch: %v, retrying in %s", err, watchRetryBackoff)
+			if !sleepOrDone(ctx, watchRetryBackoff) {
+				return
+			}
+			continue
+		}
+
+		watcher, err := resource.Watch(metav1.ListOptions{
+			LabelSelector:       fmt.Sprintf("workflow_id=%s", workflowID),
+			ResourceVersion:     resourceVersion,
+			AllowWatchBookmarks: true,
+		})
+		if err != nil {
+			log.Printf("starting Workflow watch for %s: %v, retrying in %s", workflowID, err, watchRetryBackoff)
+			if !sleepOrDone(ctx, watchRetryBackoff) {
+				return
+			}
+			continue
+		}
+
+		resourceVersion = c.drainWorkflowWatch(ctx, watcher, events, resourceVersion)
+		watcher.Stop()
+	}
+}
+
+// sleepOrDone waits out d, returning early with false if ctx is cancelled
+// first - the caller should stop retrying in that case rather than sleep out
+// the full backoff on a shutdown.
+func sleepOrDone(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// drainWorkflowWatch consumes one watch session until it ends, returning the
+// resourceVersion the caller should resume from (or "" to force a relist).
+func (c *Client) drainWorkflowWatch(ctx context.Context, watcher watch.Interface, events chan<- WorkflowEvent, resourceVersion string) string {
+	for {
+		select {
+		case <-ctx.Done():
+			return resourceVersion
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return resourceVersion
+			}
+
+			switch event.Type {
+			case watch.Bookmark:
+				if obj, ok := event.Object.(*unstructured.Unstructured); ok {
+					resourceVersion = obj.GetResourceVersion()
+				}
+				continue
+			case watch.Error:
+				err := apierrors.FromObject(event.Object)
+				if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					return ""
+				}
+				log.Printf("workflow watch error for %v: %v", workflowGVK, err)
+				return resourceVersion
+			}
+
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			resourceVersion = obj.GetResourceVersion()
+
+			we, ok := toWorkflowEvent(event.Type, obj)
+			if !ok {
+				continue
+			}
+
+			select {
+			case events <- we:
+			case <-ctx.Done():
+				return resourceVersion
+			}
+		}
+	}
+}
+
+func toWorkflowEvent(eventType watch.EventType, obj *unstructured.Unstructured) (WorkflowEvent, bool) {
+	var t WorkflowEventType
+	switch eventType {
+	case watch.Added:
+		t = WorkflowEventAdded
+	case watch.Modified:
+		t = WorkflowEventModified
+	case watch.Deleted:
+		t = WorkflowEventDeleted
+	default:
+		return WorkflowEvent{}, false
+	}
+
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	nodes, _, _ := unstructured.NestedMap(obj.Object, "status", "nodes")
+
+	return WorkflowEvent{
+		Type:  t,
+		Name:  obj.GetName(),
+		Phase: phase,
+		Nodes: nodes,
+	}, true
+}
+
+// resolveWorkflowName finds the single live Workflow/CronWorkflow carrying
+// workflow_id, replacing the old `pods.Items[0]` lookup: an empty match
+// list used to panic, and more than one match silently picked the wrong
+// object instead of erroring.
+func resolveWorkflowName(ctx context.Context, client *Client, gvk schema.GroupVersionKind, namespace, workflowID string) (string, error) {
+	list, err := client.List(ctx, gvk, namespace, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("workflow_id=%s", workflowID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch len(list.Items) {
+	case 0:
+		return "", fmt.Errorf("no %s found for workflow_id %q", gvk.Kind, workflowID)
+	case 1:
+		return list.Items[0].GetName(), nil
+	default:
+		return "", fmt.Errorf("%d %s resources matched workflow_id %q, expected exactly 1", len(list.Items), gvk.Kind, workflowID)
+	}
+}